@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
 	"log"
 	"os"
 	"os/exec"
@@ -14,59 +14,106 @@ import (
 	"github.com/fatih/color"
 
 	"golang.org/x/mod/modfile"
-	"golang.org/x/mod/module"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/Gys/cmdscanner/scanner"
 )
 
-// FileMatch represents a match of the search string in a file
-type FileMatch struct {
-	FilePath string
-	Lines    []LineMatch
+// parseExtraSinks parses a comma-separated list of user-supplied sinks of the
+// form "pkgpath.Func" or "pkgpath.(*Type).Method", e.g.
+// "github.com/foo/sh.Command,github.com/foo/sh.(*Session).Run".
+func parseExtraSinks(raw string) ([]scanner.Sink, error) {
+	var sinks []scanner.Sink
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if idx := strings.Index(entry, ".(*"); idx != -1 {
+			pkg := entry[:idx]
+			rest := entry[idx+len(".(*"):]
+			closeIdx := strings.Index(rest, ").")
+			if closeIdx == -1 {
+				return nil, fmt.Errorf("invalid sink %q: expected pkgpath.(*Type).Method", entry)
+			}
+			sinks = append(sinks, scanner.Sink{
+				Package:  pkg,
+				Receiver: rest[:closeIdx],
+				Pointer:  true,
+				Name:     rest[closeIdx+len(")."):],
+			})
+			continue
+		}
+		lastDot := strings.LastIndex(entry, ".")
+		if lastDot == -1 {
+			return nil, fmt.Errorf("invalid sink %q: expected pkgpath.Func", entry)
+		}
+		sinks = append(sinks, scanner.Sink{Package: entry[:lastDot], Name: entry[lastDot+1:]})
+	}
+	return sinks, nil
 }
 
-// LineMatch represents a single line match with line number and content
-type LineMatch struct {
-	LineNumber int
-	Content    string
-	Pattern    string // Which pattern matched
+// ModulePublic mirrors the fields we need from the JSON objects emitted by
+// `go list -m -json`, which is the same shape cmd/go uses internally
+// (golang.org/x/mod/module.Version plus Dir/Replace/Error).
+type ModulePublic struct {
+	Path     string
+	Version  string
+	Indirect bool
+	Main     bool
+	Dir      string
+	Error    *ModuleError
+	Replace  *ModulePublic
 }
 
-// CommandPatterns defines the specific command patterns we're looking for
-var CommandPatterns = []string{
-	`.Command(`,
-	`.RunCommand(`,
-	`.Cmd(`,
+// ModuleError is the error shape `go list -m -json` reports for a module
+// that could not be resolved.
+type ModuleError struct {
+	Err string
 }
 
-// getModuleCachePath returns the path to the Go module cache
-func getModuleCachePath() (string, error) {
-	cmd := exec.Command("go", "env", "GOMODCACHE")
-	output, err := cmd.Output()
+// listBuildList runs `go list -m -json all` from dir and decodes the
+// resulting stream of ModulePublic records, which is the exact build list
+// the compiler would see: MVS-selected versions, exclude/replace directives,
+// and transitively-required modules all already resolved. It falls back to
+// `-mod=mod` for modules that haven't had `go mod tidy` run against them.
+func listBuildList(dir string) ([]ModulePublic, error) {
+	mods, err := runGoListModules(dir, false)
 	if err != nil {
-		// Fallback to older method if GOMODCACHE is not available
-		cmd := exec.Command("go", "env", "GOPATH")
-		output, err = cmd.Output()
+		mods, err = runGoListModules(dir, true)
 		if err != nil {
-			return "", fmt.Errorf("failed to get GOPATH: %v", err)
+			return nil, err
 		}
-		return filepath.Join(strings.TrimSpace(string(output)), "pkg", "mod"), nil
 	}
-	return strings.TrimSpace(string(output)), nil
+	return mods, nil
 }
 
-// getPackageInstallPath returns the filesystem path where a package is installed
-func getPackageInstallPath(modulePath, version string, moduleCachePath string) string {
-	// Encode the module path to handle special characters
-	encodedPath, err := module.EscapePath(modulePath)
-	if err != nil {
-		log.Printf("Warning: Could not encode module path %s: %v", modulePath, err)
-		encodedPath = modulePath
+// runGoListModules invokes `go list -m -json all` in dir, optionally passing
+// `-mod=mod` to let the command update go.sum/go.mod as needed.
+func runGoListModules(dir string, modMod bool) ([]ModulePublic, error) {
+	args := []string{"list", "-m", "-json"}
+	if modMod {
+		args = append(args, "-mod=mod")
 	}
+	args = append(args, "all")
 
-	// For the version, we need to handle the "v" prefix and any "+incompatible" suffix
-	cleanVersion := strings.TrimSuffix(version, "+incompatible")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %w", strings.Join(args, " "), err)
+	}
 
-	// Construct the path
-	return filepath.Join(moduleCachePath, encodedPath+"@"+cleanVersion)
+	var mods []ModulePublic
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for dec.More() {
+		var mod ModulePublic
+		if err := dec.Decode(&mod); err != nil {
+			return nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
 }
 
 // checkPackageExists verifies if the package is installed at the expected location
@@ -75,77 +122,6 @@ func checkPackageExists(path string) bool {
 	return err == nil
 }
 
-// findCommandPatternsInGoFiles searches for command patterns in all .go files in the given directory and subdirectories
-func findCommandPatternsInGoFiles(rootPath string, patterns []string) ([]FileMatch, error) {
-	var matches []FileMatch
-
-	err := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			// Skip directories we can't access
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Skip directories like .git, testdata, etc.
-		if d.IsDir() {
-			dirName := filepath.Base(path)
-			if strings.HasPrefix(dirName, ".") || dirName == "testdata" || dirName == "vendor" {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Only process .go files that are not test files
-		if !strings.HasSuffix(d.Name(), ".go") || strings.HasSuffix(d.Name(), "_test.go") {
-			return nil
-		}
-
-		// Open and scan the file
-		file, err := os.Open(path)
-		if err != nil {
-			return nil
-		}
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
-		var lineMatches []LineMatch
-
-		for scanner.Scan() {
-			lineNum++
-			line := scanner.Text()
-
-			// Check each pattern
-			for _, pattern := range patterns {
-				if strings.Contains(line, pattern) {
-					// Trim trailing whitespace but preserve indentation
-					trimmedLine := strings.TrimRight(line, " \t\r\n")
-					lineMatches = append(lineMatches, LineMatch{
-						LineNumber: lineNum,
-						Content:    trimmedLine,
-						Pattern:    pattern,
-					})
-					// We found a match with this pattern, no need to check other patterns for this line
-					break
-				}
-			}
-		}
-
-		if len(lineMatches) > 0 {
-			matches = append(matches, FileMatch{
-				FilePath: path,
-				Lines:    lineMatches,
-			})
-		}
-
-		return scanner.Err()
-	})
-
-	return matches, err
-}
-
 // isGoOfficialPackage checks if a package is from the Go project itself
 func isGoOfficialPackage(packagePath string) bool {
 	return strings.HasPrefix(packagePath, "golang.org/") || strings.HasPrefix(packagePath, "google.golang.org/")
@@ -188,14 +164,640 @@ func findGoModInParentDirs() string {
 	return ""
 }
 
+// filterByCategory keeps only the lines in matches whose Category is in
+// categories, dropping files left with no lines. An empty categories list is
+// treated as "no filter" and returns matches unchanged.
+func filterByCategory(matches []scanner.FileMatch, categories []string) []scanner.FileMatch {
+	if len(categories) == 0 {
+		return matches
+	}
+	allowed := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		allowed[category] = true
+	}
+
+	filtered := make([]scanner.FileMatch, 0, len(matches))
+	for _, fileMatch := range matches {
+		var lines []scanner.LineMatch
+		for _, line := range fileMatch.Lines {
+			if allowed[line.Category] {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			fileMatch.Lines = lines
+			filtered = append(filtered, fileMatch)
+		}
+	}
+	return filtered
+}
+
+// joinSinks renders sinks as a human-readable comma-separated list.
+func joinSinks(sinks []scanner.Sink) string {
+	names := make([]string, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// findGoWorkInParentDirs searches startDir and its parents for a go.work
+// file, mirroring findGoModInParentDirs.
+func findGoWorkInParentDirs(startDir string) string {
+	dir := startDir
+	for {
+		goWorkPath := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(goWorkPath); err == nil {
+			return goWorkPath
+		}
+
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			break
+		}
+		dir = parentDir
+	}
+	return ""
+}
+
+// scanModules scans every non-main module in mods and returns both the flat
+// list of matches and a breakdown keyed by module path, the latter used to
+// group results per workspace member. When vendorModules is non-nil, it
+// scans the exact package subset recorded in vendor/modules.txt from
+// mainModuleDir instead of the module cache, so the scan works without a
+// populated GOMODCACHE and skips packages the main module never imports.
+func scanModules(sc *scanner.Scanner, mods []ModulePublic, includeGoOfficial bool, skipPackages []string, verbose bool, mainModuleDir string, vendorModules map[string]VendoredModule) (allMatches []scanner.FileMatch, byModule map[string][]scanner.FileMatch) {
+	byModule = map[string][]scanner.FileMatch{}
+
+	var targets []scanner.Target
+	var modPaths []string // mods[i].Path for each entry in targets, by index
+	var labels []string
+
+	for _, mod := range mods {
+		if mod.Main {
+			continue
+		}
+
+		// Skip Go official packages if requested
+		if !includeGoOfficial && isGoOfficialPackage(mod.Path) {
+			continue
+		}
+
+		// Skip user-specified packages
+		if shouldSkipPackage(mod.Path, skipPackages) {
+			continue
+		}
+		if mod.Replace != nil && shouldSkipPackage(mod.Replace.Path, skipPackages) {
+			continue
+		}
+
+		effectivePath, effectiveVersion := mod.Path, mod.Version
+		label := fmt.Sprintf("%s %s", mod.Path, mod.Version)
+		if mod.Replace != nil {
+			effectivePath, effectiveVersion = mod.Replace.Path, mod.Replace.Version
+			label = fmt.Sprintf("%s %s => %s %s", mod.Path, mod.Version, mod.Replace.Path, mod.Replace.Version)
+		}
+		if mod.Indirect {
+			label += " (indirect)"
+		}
+
+		if mod.Error != nil {
+			if verbose {
+				fmt.Printf("- %s\n", label)
+				fmt.Printf("  Error resolving module: %s\n\n", mod.Error.Err)
+			}
+			continue
+		}
+
+		var scanDir string
+		var patterns []string
+		if vendorModules != nil {
+			vendored, ok := vendorModules[mod.Path]
+			if !ok || len(vendored.Packages) == 0 {
+				if verbose {
+					fmt.Printf("- %s\n", label)
+					fmt.Printf("  Not vendored (no packages imported)\n\n")
+				}
+				continue
+			}
+			scanDir = mainModuleDir
+			patterns = vendored.Packages
+		} else {
+			scanDir = mod.Dir
+			if mod.Replace != nil {
+				scanDir = mod.Replace.Dir
+			}
+			if scanDir == "" || !checkPackageExists(scanDir) {
+				if verbose {
+					fmt.Printf("- %s\n", label)
+					fmt.Printf("  Location not found (%s)\n\n", scanDir)
+				}
+				continue
+			}
+		}
+
+		targets = append(targets, scanner.Target{
+			ModulePath:    effectivePath,
+			ModuleVersion: effectiveVersion,
+			Indirect:      mod.Indirect,
+			Dir:           scanDir,
+			Patterns:      patterns,
+		})
+		modPaths = append(modPaths, mod.Path)
+		labels = append(labels, label)
+	}
+
+	// Scan every target concurrently; the result order matches targets.
+	for i, result := range sc.Scan(targets) {
+		if result.Err != nil {
+			if verbose {
+				fmt.Printf("- %s\n", labels[i])
+				fmt.Printf("  Error scanning: %v\n\n", result.Err)
+			}
+			continue
+		}
+		allMatches = append(allMatches, result.Matches...)
+		byModule[modPaths[i]] = append(byModule[modPaths[i]], result.Matches...)
+	}
+
+	return allMatches, byModule
+}
+
+// VendoredModule is one `# <module> <version>` section of vendor/modules.txt:
+// a module and the exact subset of its packages the main module vendored
+// (and therefore actually imports somewhere in the build).
+type VendoredModule struct {
+	Path     string
+	Version  string
+	Packages []string
+}
+
+// parseVendorModules parses vendor/modules.txt, keyed by module path. Lines
+// starting with "## " are annotations (e.g. "## explicit") and are ignored;
+// every other "# " line starts a new module section, and every plain line
+// under it is a vendored package import path belonging to that module. When
+// a module is replaced, `go mod vendor` writes the replace directive directly
+// on that module's own header line as "# <path> <version> => <new> [version]"
+// rather than as a separate line, so the "=>" suffix is stripped before
+// extracting the path/version and does not get special-cased as anything
+// other than a normal section header. A module pulled in only to satisfy a
+// replace can have no package lines of its own; an empty `Packages` is valid
+// and is treated as "not actually vendored" by callers.
+func parseVendorModules(modulesTxtPath string) (map[string]VendoredModule, error) {
+	data, err := os.ReadFile(modulesTxtPath)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := map[string]VendoredModule{}
+	var current VendoredModule
+	flush := func() {
+		if current.Path != "" {
+			modules[current.Path] = current
+		}
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.HasPrefix(line, "## "):
+			continue
+		case strings.HasPrefix(line, "# "):
+			flush()
+			rest := line[len("# "):]
+			if idx := strings.Index(rest, "=>"); idx != -1 {
+				rest = rest[:idx]
+			}
+			fields := strings.Fields(rest)
+			current = VendoredModule{}
+			if len(fields) >= 2 {
+				current.Path, current.Version = fields[0], fields[1]
+			}
+		default:
+			if pkg := strings.TrimSpace(line); pkg != "" && current.Path != "" {
+				current.Packages = append(current.Packages, pkg)
+			}
+		}
+	}
+	flush()
+
+	return modules, nil
+}
+
+// directRequires returns the set of module paths that the go.mod at
+// goModPath requires directly.
+func directRequires(goModPath string) (map[string]bool, error) {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := modfile.Parse(goModPath, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	requires := make(map[string]bool, len(file.Require))
+	for _, req := range file.Require {
+		requires[req.Mod.Path] = true
+	}
+	return requires, nil
+}
+
+// buildModuleGraph builds the module requirement graph reachable from the
+// build list: an edge mod path -> required mod path for every require
+// directive, read from each module's own go.mod, since `go list -m -json
+// all` only reports the flattened, MVS-selected build list rather than the
+// graph edges. This includes every Main entry in mods, not just one: single
+// module mode has exactly one, a workspace has one per member, and each
+// needs its own requires in the graph for per-member provenance.
+func buildModuleGraph(mods []ModulePublic) map[string][]string {
+	graph := map[string][]string{}
+
+	for _, mod := range mods {
+		dir := mod.Dir
+		path := mod.Path
+		if mod.Replace != nil {
+			dir = mod.Replace.Dir
+		}
+		if dir == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err != nil {
+			continue
+		}
+		depFile, err := modfile.Parse(filepath.Join(dir, "go.mod"), data, nil)
+		if err != nil {
+			continue
+		}
+		for _, req := range depFile.Require {
+			graph[path] = append(graph[path], req.Mod.Path)
+		}
+	}
+	return graph
+}
+
+// bfsModuleChain returns the shortest chain of module paths from start to
+// target (inclusive of both ends), or nil if target is unreachable from
+// start in graph.
+func bfsModuleChain(graph map[string][]string, start, target string) []string {
+	if start == target {
+		return []string{start}
+	}
+	visited := map[string]bool{start: true}
+	parent := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range graph[cur] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			parent[next] = cur
+			if next == target {
+				return reconstructChain(parent, start, target)
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// reconstructChain walks parent backwards from target to start and returns
+// the path in start-to-target order.
+func reconstructChain(parent map[string]string, start, target string) []string {
+	chain := []string{target}
+	for node := target; node != start; {
+		node = parent[node]
+		chain = append(chain, node)
+	}
+	reverseChain(chain)
+	return chain
+}
+
+// reverseChain reverses chain in place.
+func reverseChain(chain []string) {
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+}
+
+// buildPackageGraph loads every package reachable from mainModuleDir and
+// returns its import graph (package path -> imported package paths) along
+// with the set of package paths that belong to the main module itself. Mode
+// includes NeedDeps so the returned graph covers the full transitive closure,
+// not just the main module's direct imports.
+func buildPackageGraph(mainModuleDir string) (graph map[string][]string, roots map[string]bool, err error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedImports | packages.NeedDeps,
+		Dir:  mainModuleDir,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading packages under %s: %w", mainModuleDir, err)
+	}
+
+	graph = map[string][]string{}
+	roots = map[string]bool{}
+	visited := map[string]bool{}
+
+	var visit func(pkg *packages.Package)
+	visit = func(pkg *packages.Package) {
+		if visited[pkg.PkgPath] {
+			return
+		}
+		visited[pkg.PkgPath] = true
+		for importPath, imp := range pkg.Imports {
+			graph[pkg.PkgPath] = append(graph[pkg.PkgPath], importPath)
+			visit(imp)
+		}
+	}
+	for _, pkg := range pkgs {
+		roots[pkg.PkgPath] = true
+		visit(pkg)
+	}
+	return graph, roots, nil
+}
+
+// bfsPackageChain runs a multi-source BFS from every package in roots to
+// target over graph, returning the shortest chain of package paths
+// (inclusive of both ends), or nil if target is unreachable.
+func bfsPackageChain(graph map[string][]string, roots map[string]bool, target string) []string {
+	if roots[target] {
+		return []string{target}
+	}
+	visited := map[string]bool{}
+	parent := map[string]string{}
+	var queue []string
+	for root := range roots {
+		if !visited[root] {
+			visited[root] = true
+			queue = append(queue, root)
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range graph[cur] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			parent[next] = cur
+			if next == target {
+				chain := []string{target}
+				for node := target; !roots[node]; {
+					node = parent[node]
+					chain = append(chain, node)
+				}
+				reverseChain(chain)
+				return chain
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
+
+// annotateProvenance sets ImportChain on each match: the shortest chain of
+// package import paths from a root package to the finding's package when the
+// package-level graph can prove reachability, falling back to the coarser
+// module-level chain when it can't (e.g. the module is required but the
+// offending package is never actually imported). rootModPaths is the set of
+// main module paths to chain from: single module mode has exactly one, a
+// workspace has one per member, and the shortest chain across all of them
+// wins.
+func annotateProvenance(matches []scanner.FileMatch, rootModPaths []string, moduleGraph, packageGraph map[string][]string, packageRoots map[string]bool) {
+	for i := range matches {
+		fm := &matches[i]
+		var chain []string
+		if packageGraph != nil && fm.PackagePath != "" {
+			chain = bfsPackageChain(packageGraph, packageRoots, fm.PackagePath)
+		}
+		if chain == nil {
+			for _, root := range rootModPaths {
+				c := bfsModuleChain(moduleGraph, root, fm.ModulePath)
+				if c != nil && (chain == nil || len(c) < len(chain)) {
+					chain = c
+				}
+			}
+		}
+		fm.ImportChain = chain
+	}
+}
+
+// printResults prints the detailed, colorized summary of matches, after
+// applying the category filter.
+func printResults(matches []scanner.FileMatch, categories []string) {
+	matches = filterByCategory(matches, categories)
+
+	if len(matches) == 0 {
+		fmt.Printf("No dangerous calls found in any files.\n\n")
+		return
+	}
+
+	totalOccurrences := 0
+	for _, fileMatch := range matches {
+		totalOccurrences += len(fileMatch.Lines)
+	}
+
+	fmt.Printf("Found %d dangerous call occurrences in %d files:\n\n", totalOccurrences, len(matches))
+
+	style := color.New(color.FgHiYellow)
+	for _, fileMatch := range matches {
+		for _, line := range fileMatch.Lines {
+			constStr := "tainted args"
+			if line.ConstArgs {
+				constStr = "constant args"
+			}
+			fmt.Printf("%s:%d [%s, %s, %s]\n", fileMatch.FilePath, line.LineNumber, line.Category, line.Sink, constStr)
+			style.Printf("%s\n", line.Content)
+		}
+		if len(fileMatch.ImportChain) > 0 {
+			fmt.Printf("  via: %s\n", strings.Join(fileMatch.ImportChain, " -> "))
+		}
+		fmt.Println()
+	}
+}
+
+// Finding is the stable, CI-consumable shape of a single match, used by the
+// json and sarif output formats. Unlike scanner.FileMatch/scanner.LineMatch, which group
+// lines under a file for the text format, each Finding stands alone so it
+// round-trips cleanly through tools that don't know about cmdscanner.
+type Finding struct {
+	FilePath      string   `json:"filePath"`
+	LineNumber    int      `json:"lineNumber"`
+	Sink          string   `json:"sink"`
+	Category      string   `json:"category"`
+	ConstArgs     bool     `json:"constArgs"`
+	ModulePath    string   `json:"modulePath"`
+	ModuleVersion string   `json:"moduleVersion"`
+	Indirect      bool     `json:"indirect"`
+	ImportChain   []string `json:"importChain,omitempty"`
+}
+
+// toFindings flattens matches (already filtered by category) into Findings.
+func toFindings(matches []scanner.FileMatch) []Finding {
+	var findings []Finding
+	for _, fileMatch := range matches {
+		for _, line := range fileMatch.Lines {
+			findings = append(findings, Finding{
+				FilePath:      fileMatch.FilePath,
+				LineNumber:    line.LineNumber,
+				Sink:          line.Sink,
+				Category:      line.Category,
+				ConstArgs:     line.ConstArgs,
+				ModulePath:    fileMatch.ModulePath,
+				ModuleVersion: fileMatch.ModuleVersion,
+				Indirect:      fileMatch.Indirect,
+				ImportChain:   fileMatch.ImportChain,
+			})
+		}
+	}
+	return findings
+}
+
+// printJSON marshals matches as a stable JSON schema for CI consumption.
+func printJSON(matches []scanner.FileMatch, categories []string) {
+	matches = filterByCategory(matches, categories)
+	out, err := json.MarshalIndent(struct {
+		Findings []Finding `json:"findings"`
+	}{Findings: toFindings(matches)}, "", "  ")
+	if err != nil {
+		log.Fatalf("Error marshaling JSON output: %v", err)
+	}
+	fmt.Println(string(out))
+}
+
+// SARIF 2.1.0 types, trimmed down to the fields cmdscanner needs to produce a
+// report that GitHub code scanning (and other SARIF consumers) can ingest.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// printSARIF marshals matches as a SARIF 2.1.0 report, using the finding
+// category as the ruleId so results group the same way -category does.
+func printSARIF(matches []scanner.FileMatch, categories []string) {
+	matches = filterByCategory(matches, categories)
+
+	rules := map[string]bool{scanner.CategoryCommandExec: true, scanner.CategoryUnsafePathLookup: true}
+	report := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "cmdscanner",
+				InformationURI: "https://github.com/Gys/cmdscanner",
+			}},
+		}},
+	}
+	for rule := range rules {
+		report.Runs[0].Tool.Driver.Rules = append(report.Runs[0].Tool.Driver.Rules, sarifRule{ID: rule})
+	}
+
+	for _, finding := range toFindings(matches) {
+		text := fmt.Sprintf("%s (%s %s)", finding.Sink, finding.ModulePath, finding.ModuleVersion)
+		if len(finding.ImportChain) > 0 {
+			text += fmt.Sprintf(" via %s", strings.Join(finding.ImportChain, " -> "))
+		}
+		report.Runs[0].Results = append(report.Runs[0].Results, sarifResult{
+			RuleID:  finding.Category,
+			Message: sarifMessage{Text: text},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: finding.FilePath},
+				Region:           sarifRegion{StartLine: finding.LineNumber},
+			}}},
+		})
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println("Error marshaling SARIF output:", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(out))
+}
+
+// emitResults renders matches in the requested output format.
+func emitResults(format string, matches []scanner.FileMatch, categories []string) {
+	switch format {
+	case "json":
+		printJSON(matches, categories)
+	case "sarif":
+		printSARIF(matches, categories)
+	default:
+		printResults(matches, categories)
+	}
+}
+
 func main() {
 	// Define command-line flags
 	goModPath := flag.String("file", "go.mod", "Path to the go.mod file to parse")
 	includeGoOfficial := flag.Bool("include-go-official", false, "Include packages from *.golang.org")
 	skipPackagesFlag := flag.String("skip", "", "Comma-separated list of packages to skip scanning")
+	extraSinksFlag := flag.String("extra-sinks", "", "Comma-separated list of additional sinks to flag, e.g. github.com/foo/sh.Command,github.com/foo/sh.(*Session).Run")
+	categoryFlag := flag.String("category", "", "Comma-separated list of finding categories to report (CommandExec, UnsafePathLookup); default is all")
+	workspaceFlag := flag.Bool("workspace", false, "Require workspace mode: fail if no go.work is found alongside or above -file's directory (a found go.work is used even without this flag)")
+	formatFlag := flag.String("format", "text", "Output format: text, json, or sarif")
 	noColor := flag.Bool("no-color", false, "Disable color output")
+	jFlag := flag.Int("j", 0, "Number of modules to scan concurrently; 0 means runtime.NumCPU()")
+	noCacheFlag := flag.Bool("no-cache", false, "Disable the on-disk per-file result cache")
 	flag.Parse()
 
+	switch *formatFlag {
+	case "text", "json", "sarif":
+	default:
+		log.Fatalf("Error: -format must be text, json, or sarif (got %q)", *formatFlag)
+	}
+
 	// Apply the setting
 	color.NoColor = *noColor
 
@@ -208,6 +810,57 @@ func main() {
 		}
 	}
 
+	// Parse the category filter flag
+	var categories []string
+	if *categoryFlag != "" {
+		for _, category := range strings.Split(*categoryFlag, ",") {
+			categories = append(categories, strings.TrimSpace(category))
+		}
+	}
+
+	// Build the sink list
+	sinks := append([]scanner.Sink{}, scanner.DefaultSinks...)
+	if *extraSinksFlag != "" {
+		extraSinks, err := parseExtraSinks(*extraSinksFlag)
+		if err != nil {
+			log.Fatalf("Error parsing -extra-sinks: %v", err)
+		}
+		sinks = append(sinks, extraSinks...)
+	}
+
+	sc := scanner.New(sinks)
+	sc.Workers = *jFlag
+	sc.NoCache = *noCacheFlag
+
+	// Determine whether we're operating on a workspace. -file can point
+	// directly at a go.work file; otherwise, mirroring `go`'s own GOWORK
+	// auto-detection, a go.work found alongside or above -file's directory
+	// is used automatically. -workspace runs the same search and only turns
+	// a missing go.work into a fatal error instead of falling back to single
+	// module mode.
+	startDir := filepath.Dir(*goModPath)
+	if startDir == "." {
+		if cwd, err := os.Getwd(); err == nil {
+			startDir = cwd
+		}
+	}
+	var goWorkPath string
+	switch {
+	case filepath.Base(*goModPath) == "go.work":
+		goWorkPath = *goModPath
+	case *workspaceFlag:
+		goWorkPath = findGoWorkInParentDirs(startDir)
+		if goWorkPath == "" {
+			log.Fatalf("Error: -workspace given but no go.work file found")
+		}
+	default:
+		goWorkPath = findGoWorkInParentDirs(startDir)
+	}
+	if goWorkPath != "" {
+		runWorkspace(goWorkPath, sc, *includeGoOfficial, skipPackages, categories, *formatFlag)
+		return
+	}
+
 	// Check if the file exists
 	if _, err := os.Stat(*goModPath); os.IsNotExist(err) {
 		// Try to find go.mod in parent directories
@@ -219,156 +872,187 @@ func main() {
 		}
 	}
 
+	runSingleModule(*goModPath, sc, *includeGoOfficial, skipPackages, categories, *formatFlag)
+}
+
+// runSingleModule scans the build list rooted at the go.mod at goModPath.
+func runSingleModule(goModPath string, sc *scanner.Scanner, includeGoOfficial bool, skipPackages, categories []string, format string) {
 	// Read the go.mod file
-	data, err := os.ReadFile(*goModPath)
+	data, err := os.ReadFile(goModPath)
 	if err != nil {
 		log.Fatalf("Error reading go.mod file: %v", err)
 	}
 
-	// Parse the go.mod file
-	file, err := modfile.Parse(*goModPath, data, nil)
+	// Parse the go.mod file for banner information (module path, Go version)
+	file, err := modfile.Parse(goModPath, data, nil)
 	if err != nil {
 		log.Fatalf("Error parsing go.mod file: %v", err)
 	}
 
-	// Get the module cache path
-	moduleCachePath, err := getModuleCachePath()
+	// Resolve the real build list the compiler would use: MVS-selected
+	// versions, exclude/replace directives, and indirect dependencies only
+	// reachable transitively all come pre-resolved from `go list`.
+	mods, err := listBuildList(filepath.Dir(goModPath))
 	if err != nil {
-		log.Fatalf("Error getting module cache path: %v", err)
+		log.Fatalf("Error listing build list: %v", err)
 	}
 
-	// Print module information
-	fmt.Printf("Module: %s\n", file.Module.Mod.Path)
-	fmt.Printf("Go version: %s\n", file.Go.Version)
-	fmt.Printf("Module cache location: %s\n", moduleCachePath)
-	fmt.Printf("Searching for command patterns: %s\n", strings.Join(CommandPatterns, ", "))
-	fmt.Printf("Skipping test files (*_test.go)\n")
-	if *includeGoOfficial {
-		fmt.Printf("Including official Go packages (*.golang.org/*)\n")
-	} else {
-		fmt.Printf("Skipping official Go packages (*.golang.org/*)\n")
+	// Prefer the vendor directory over GOMODCACHE when the main module
+	// vendors its dependencies: it works without a populated module cache
+	// and only contains the packages actually imported.
+	mainModuleDir := filepath.Dir(goModPath)
+	var vendorModules map[string]VendoredModule
+	modulesTxtPath := filepath.Join(mainModuleDir, "vendor", "modules.txt")
+	if _, err := os.Stat(modulesTxtPath); err == nil {
+		vendorModules, err = parseVendorModules(modulesTxtPath)
+		if err != nil {
+			log.Fatalf("Error parsing %s: %v", modulesTxtPath, err)
+		}
 	}
-	if len(skipPackages) > 0 {
-		fmt.Printf("Skipping user-specified packages: %s\n", strings.Join(skipPackages, ", "))
+
+	if format == "text" {
+		fmt.Printf("Module: %s\n", file.Module.Mod.Path)
+		fmt.Printf("Go version: %s\n", file.Go.Version)
+		if vendorModules != nil {
+			fmt.Printf("Using vendor directory: %s\n", filepath.Join(mainModuleDir, "vendor"))
+		}
+		printScanHeader(sc.Sinks, includeGoOfficial, skipPackages)
 	}
-	fmt.Println()
 
-	// Store all files containing command patterns
-	var allMatches []FileMatch
+	allMatches, _ := scanModules(sc, mods, includeGoOfficial, skipPackages, format == "text", mainModuleDir, vendorModules)
 
-	// Process all dependencies
-	for _, req := range file.Require {
-		// Skip Go official packages if requested
-		if !*includeGoOfficial && isGoOfficialPackage(req.Mod.Path) {
-			// fmt.Printf("- %s %s (skipped - Go official package)\n\n", req.Mod.Path, req.Mod.Version)
-			continue
-		}
+	// Work out, for each finding, the shortest import path reaching it from
+	// the main module, so users can tell a reachable exec.Command from dead
+	// weight pulled in by an unused indirect dependency.
+	moduleGraph := buildModuleGraph(mods)
+	packageGraph, packageRoots, err := buildPackageGraph(filepath.Dir(goModPath))
+	if err != nil {
+		log.Printf("Warning: could not build package import graph for provenance: %v", err)
+	}
+	annotateProvenance(allMatches, []string{file.Module.Mod.Path}, moduleGraph, packageGraph, packageRoots)
 
-		// Skip user-specified packages
-		if shouldSkipPackage(req.Mod.Path, skipPackages) {
-			// fmt.Printf("- %s %s (skipped - user-specified)\n\n", req.Mod.Path, req.Mod.Version)
-			continue
-		}
+	if format == "text" {
+		fmt.Printf("Results:\n\n")
+	}
+	emitResults(format, allMatches, categories)
+}
 
-		installPath := getPackageInstallPath(req.Mod.Path, req.Mod.Version, moduleCachePath)
-		exists := checkPackageExists(installPath)
+// runWorkspace scans the union of the build lists of every go.work member
+// rooted at goWorkPath, then prints the results grouped per member.
+func runWorkspace(goWorkPath string, sc *scanner.Scanner, includeGoOfficial bool, skipPackages, categories []string, format string) {
+	data, err := os.ReadFile(goWorkPath)
+	if err != nil {
+		log.Fatalf("Error reading go.work file: %v", err)
+	}
+	work, err := modfile.ParseWork(goWorkPath, data, nil)
+	if err != nil {
+		log.Fatalf("Error parsing go.work file: %v", err)
+	}
 
-		indirectStr := ""
-		if req.Indirect {
-			indirectStr = " (indirect)"
-		}
+	workspaceDir := filepath.Dir(goWorkPath)
 
-		if !exists {
-			fmt.Printf("- %s %s%s\n", req.Mod.Path, req.Mod.Version, indirectStr)
-			fmt.Printf("  Location not found (%s)\n\n", installPath)
-			continue
-		}
+	// `go list -m -json all`, run from the workspace directory, already
+	// resolves the union of every member's require/replace graph per Go's
+	// workspace (GOWORK) support.
+	mods, err := listBuildList(workspaceDir)
+	if err != nil {
+		log.Fatalf("Error listing build list: %v", err)
+	}
 
-		// Find all .go files containing command patterns
-		matches, err := findCommandPatternsInGoFiles(installPath, CommandPatterns)
-		if err != nil {
-			fmt.Printf("- %s %s%s\n", req.Mod.Path, req.Mod.Version, indirectStr)
-			fmt.Printf("  Error scanning: %v\n\n", err)
-		} else {
-			allMatches = append(allMatches, matches...)
+	if format == "text" {
+		fmt.Printf("Workspace: %s\n", goWorkPath)
+		fmt.Printf("Members: %d\n", len(work.Use))
+		printScanHeader(sc.Sinks, includeGoOfficial, skipPackages)
+	}
+
+	allMatches, byModule := scanModules(sc, mods, includeGoOfficial, skipPackages, format == "text", workspaceDir, nil)
+
+	// Work out, for each finding, the shortest import path reaching it from
+	// any workspace member, same as single module mode. A workspace has one
+	// root module per member rather than one, so every member's go.mod
+	// contributes requires to moduleGraph and every member is a candidate
+	// chain start.
+	var rootModPaths []string
+	for _, mod := range mods {
+		if mod.Main {
+			rootModPaths = append(rootModPaths, mod.Path)
 		}
-		// fmt.Println()
 	}
+	moduleGraph := buildModuleGraph(mods)
+	packageGraph, packageRoots, err := buildPackageGraph(workspaceDir)
+	if err != nil {
+		log.Printf("Warning: could not build package import graph for provenance: %v", err)
+	}
+	annotateProvenance(allMatches, rootModPaths, moduleGraph, packageGraph, packageRoots)
 
-	// Process replace directives
-	if len(file.Replace) > 0 {
-		for _, rep := range file.Replace {
-			// Skip user-specified packages
-			if shouldSkipPackage(rep.Old.Path, skipPackages) || shouldSkipPackage(rep.New.Path, skipPackages) {
-				// fmt.Printf("- %s %s => %s %s (skipped - user-specified)\n\n", rep.Old.Path, rep.Old.Version, rep.New.Path, rep.New.Version)
-				continue
-			}
+	// scanModules built byModule from the same scan results before provenance
+	// existed, so its per-module slices are separate copies of FileMatch still
+	// missing ImportChain: annotate them too. They stay keyed by the required
+	// module path, which is what directRequires reports below, even when the
+	// module is replaced.
+	for _, matches := range byModule {
+		annotateProvenance(matches, rootModPaths, moduleGraph, packageGraph, packageRoots)
+	}
 
-			var replacementPath string
-			// var isLocalPath bool
+	// JSON/SARIF consumers expect a single report, not one per member.
+	if format != "text" {
+		emitResults(format, allMatches, categories)
+		return
+	}
 
-			if rep.New.Version == "" {
-				// Local replacement (filesystem path)
-				replacementPath = rep.New.Path
-				// isLocalPath = true
-			} else {
-				// Module replacement
-				replacementPath = getPackageInstallPath(rep.New.Path, rep.New.Version, moduleCachePath)
-			}
+	// attributed tracks every module path that matched at least one member's
+	// direct requires, so we can warn about findings that fell through the
+	// cracks below.
+	attributed := map[string]bool{}
 
-			exists := checkPackageExists(replacementPath)
-			if !exists {
-				fmt.Printf("- %s %s => %s %s\n", rep.Old.Path, rep.Old.Version, rep.New.Path, rep.New.Version)
-				fmt.Printf("  Location not found (%s)\n\n", replacementPath)
-				continue
-			}
+	for _, use := range work.Use {
+		memberDir := filepath.Join(workspaceDir, use.Path)
+		memberGoMod := filepath.Join(memberDir, "go.mod")
 
-			// if isLocalPath {
-			// 	fmt.Printf("  Location: %s (local filesystem)\n", replacementPath)
-			// } else {
-			// 	fmt.Printf("  Location: %s\n", replacementPath)
-			// }
-
-			// Find all .go files containing command patterns
-			matches, err := findCommandPatternsInGoFiles(replacementPath, CommandPatterns)
-			if err != nil {
-				fmt.Printf("- %s %s => %s %s\n", rep.Old.Path, rep.Old.Version, rep.New.Path, rep.New.Version)
-				fmt.Printf("  Error scanning: %v\n\n", err)
-			} else {
-				allMatches = append(allMatches, matches...)
-			}
-			// fmt.Println()
+		requires, err := directRequires(memberGoMod)
+		if err != nil {
+			fmt.Printf("=== Workspace member: %s ===\n\n", use.Path)
+			fmt.Printf("Error reading %s: %v\n\n", memberGoMod, err)
+			continue
 		}
-	}
 
-	// Print detailed summary of all files containing command patterns
-	fmt.Printf("Results:\n\n")
-	if len(allMatches) == 0 {
-		fmt.Printf("No command patterns found in any files.\n\n")
-	} else {
-		totalOccurrences := 0
-		for _, fileMatch := range allMatches {
-			totalOccurrences += len(fileMatch.Lines)
+		var memberMatches []scanner.FileMatch
+		for modPath, matches := range byModule {
+			if requires[modPath] {
+				memberMatches = append(memberMatches, matches...)
+				attributed[modPath] = true
+			}
 		}
 
-		fmt.Printf("Found %d command pattern occurrences in %d files:\n\n", totalOccurrences, len(allMatches))
+		fmt.Printf("=== Workspace member: %s (%s) ===\n\n", use.Path, memberDir)
+		printResults(memberMatches, categories)
+	}
 
-		// Group matches by pattern
-		patternCounts := make(map[string]int)
-		for _, fileMatch := range allMatches {
-			for _, line := range fileMatch.Lines {
-				patternCounts[line.Pattern]++
-			}
+	// directRequires only sees a member's *direct* requires, so a module
+	// findable only through a transitive edge (or a stale, non-tidy go.mod)
+	// never matches any member's set above and its findings silently vanish
+	// from every per-member section. Warn loudly instead of staying quiet,
+	// since per-member attribution is the whole point of workspace mode.
+	for modPath, matches := range byModule {
+		if attributed[modPath] || len(matches) == 0 {
+			continue
 		}
+		fmt.Printf("Warning: %d finding(s) in %s were not attributed to any workspace member's direct requires (the dependency may only be reachable transitively, or a member's go.mod is stale); re-run with -format json for the full unfiltered result.\n", len(matches), modPath)
+	}
+}
 
-		// Print detailed file matches
-		style := color.New(color.FgHiYellow)
-		for _, fileMatch := range allMatches {
-			for _, line := range fileMatch.Lines {
-				fmt.Printf("%s:%d\n", fileMatch.FilePath, line.LineNumber)
-				style.Printf("%s\n", strings.TrimSpace(line.Content))
-			}
-			fmt.Println()
-		}
+// printScanHeader prints the scan configuration banner shared by single
+// module and workspace mode.
+func printScanHeader(sinks []scanner.Sink, includeGoOfficial bool, skipPackages []string) {
+	fmt.Printf("Searching for dangerous calls: %s\n", joinSinks(sinks))
+	fmt.Printf("Skipping test files (*_test.go)\n")
+	if includeGoOfficial {
+		fmt.Printf("Including official Go packages (*.golang.org/*)\n")
+	} else {
+		fmt.Printf("Skipping official Go packages (*.golang.org/*)\n")
 	}
+	if len(skipPackages) > 0 {
+		fmt.Printf("Skipping user-specified packages: %s\n", strings.Join(skipPackages, ", "))
+	}
+	fmt.Println()
 }
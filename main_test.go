@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseVendorModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]VendoredModule
+	}{
+		{
+			name: "simple module with packages",
+			content: `# github.com/foo/bar v1.2.3
+## explicit
+github.com/foo/bar
+github.com/foo/bar/sub
+`,
+			want: map[string]VendoredModule{
+				"github.com/foo/bar": {
+					Path:     "github.com/foo/bar",
+					Version:  "v1.2.3",
+					Packages: []string{"github.com/foo/bar", "github.com/foo/bar/sub"},
+				},
+			},
+		},
+		{
+			name: "multiple modules",
+			content: `# github.com/foo/bar v1.2.3
+## explicit
+github.com/foo/bar
+# github.com/baz/qux v0.1.0
+github.com/baz/qux
+`,
+			want: map[string]VendoredModule{
+				"github.com/foo/bar": {Path: "github.com/foo/bar", Version: "v1.2.3", Packages: []string{"github.com/foo/bar"}},
+				"github.com/baz/qux": {Path: "github.com/baz/qux", Version: "v0.1.0", Packages: []string{"github.com/baz/qux"}},
+			},
+		},
+		{
+			// Real `go mod vendor` output puts the replace directive directly
+			// on the replaced module's own header line, not on a trailing
+			// line of its own. The "=>" suffix must be stripped, not treated
+			// as disqualifying the line from starting a new section.
+			name: "replaced module header carries the replace arrow inline",
+			content: `# github.com/foo/bar v1.2.3 => github.com/foo/bar v1.2.3
+## explicit; go 1.21.6
+github.com/foo/bar
+github.com/foo/bar/sub
+`,
+			want: map[string]VendoredModule{
+				"github.com/foo/bar": {
+					Path:     "github.com/foo/bar",
+					Version:  "v1.2.3",
+					Packages: []string{"github.com/foo/bar", "github.com/foo/bar/sub"},
+				},
+			},
+		},
+		{
+			name: "replaced module header, replacement without a version",
+			content: `# github.com/foo/bar v1.2.3 => ../local/bar
+github.com/foo/bar
+`,
+			want: map[string]VendoredModule{
+				"github.com/foo/bar": {Path: "github.com/foo/bar", Version: "v1.2.3", Packages: []string{"github.com/foo/bar"}},
+			},
+		},
+		{
+			name: "replaced module with no packages of its own is still a valid, empty section",
+			content: `# github.com/foo/bar v1.2.3
+github.com/foo/bar
+# github.com/baz/qux v0.1.0 => github.com/baz/qux v0.1.0
+## explicit; go 1.21.6
+`,
+			want: map[string]VendoredModule{
+				"github.com/foo/bar": {Path: "github.com/foo/bar", Version: "v1.2.3", Packages: []string{"github.com/foo/bar"}},
+				"github.com/baz/qux": {Path: "github.com/baz/qux", Version: "v0.1.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "modules.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatalf("writing fixture: %v", err)
+			}
+
+			got, err := parseVendorModules(path)
+			if err != nil {
+				t.Fatalf("parseVendorModules: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseVendorModules() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBfsModuleChain(t *testing.T) {
+	graph := map[string][]string{
+		"main": {"a", "b"},
+		"a":    {"c"},
+		"b":    {"c", "d"},
+		"c":    {"e"},
+	}
+
+	tests := []struct {
+		name   string
+		start  string
+		target string
+		want   []string
+	}{
+		{name: "start equals target", start: "main", target: "main", want: []string{"main"}},
+		{name: "direct edge", start: "main", target: "a", want: []string{"main", "a"}},
+		{name: "first of two equal-length paths", start: "main", target: "c", want: []string{"main", "a", "c"}},
+		{name: "unreachable", start: "main", target: "z", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bfsModuleChain(graph, tt.start, tt.target)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bfsModuleChain(%q, %q) = %v, want %v", tt.start, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBfsPackageChain(t *testing.T) {
+	graph := map[string][]string{
+		"main/cmd":        {"main/internal/a"},
+		"main/internal/a": {"pkg/util"},
+		"pkg/util":        {"pkg/util/deep"},
+	}
+	roots := map[string]bool{"main/cmd": true}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []string
+	}{
+		{name: "root is target", target: "main/cmd", want: []string{"main/cmd"}},
+		{name: "reachable target", target: "pkg/util/deep", want: []string{"main/cmd", "main/internal/a", "pkg/util", "pkg/util/deep"}},
+		{name: "unreachable target", target: "nope", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bfsPackageChain(graph, roots, tt.target)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bfsPackageChain(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileCacheEntry is the persisted, per-file record, keyed by absolute path:
+// if a file's mtime and size still match, its Lines (and the package path it
+// was found in) can be reused without re-parsing or re-type-checking it.
+type fileCacheEntry struct {
+	ModTime     int64       `json:"modTime"`
+	Size        int64       `json:"size"`
+	PackagePath string      `json:"packagePath"`
+	Lines       []LineMatch `json:"lines"`
+}
+
+// fileCache is an on-disk cache of fileCacheEntry records for one sink
+// configuration. Because a dependency's module cache path (e.g.
+// $GOMODCACHE/github.com/foo/bar@v1.2.3) is identical across every project
+// that depends on that version, the cache is effectively shared across
+// projects, not just across runs of the same one.
+type fileCache struct {
+	mu       sync.Mutex
+	path     string
+	entries  map[string]fileCacheEntry
+	dirty    bool
+	disabled bool
+}
+
+// loadFileCache loads the cache file for key (a hash of the active sink
+// configuration) from dir. A missing or unreadable cache file just starts
+// empty rather than failing the scan.
+func loadFileCache(dir, key string, disabled bool) *fileCache {
+	fc := &fileCache{disabled: disabled, entries: map[string]fileCacheEntry{}}
+	if disabled {
+		return fc
+	}
+	fc.path = filepath.Join(dir, key+".json")
+	data, err := os.ReadFile(fc.path)
+	if err != nil {
+		return fc
+	}
+	_ = json.Unmarshal(data, &fc.entries)
+	return fc
+}
+
+// lookup returns the cached entry for path if one exists and its mtime/size
+// still match info.
+func (fc *fileCache) lookup(path string, info os.FileInfo) (fileCacheEntry, bool) {
+	if fc.disabled {
+		return fileCacheEntry{}, false
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry, ok := fc.entries[path]
+	if !ok || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() {
+		return fileCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// store records entry for path, stamping it with info's current mtime/size.
+func (fc *fileCache) store(path string, info os.FileInfo, entry fileCacheEntry) {
+	if fc.disabled {
+		return
+	}
+	entry.ModTime = info.ModTime().UnixNano()
+	entry.Size = info.Size()
+	fc.mu.Lock()
+	fc.entries[path] = entry
+	fc.dirty = true
+	fc.mu.Unlock()
+}
+
+// flush persists the cache to disk if it has changed since it was loaded.
+func (fc *fileCache) flush() error {
+	if fc.disabled {
+		return nil
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if !fc.dirty {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fc.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(fc.entries)
+	if err != nil {
+		return err
+	}
+	tmp := fc.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fc.path)
+}
+
+// defaultCacheDir returns $XDG_CACHE_HOME/cmdscanner, falling back to
+// ~/.cache/cmdscanner when XDG_CACHE_HOME is unset.
+func defaultCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "cmdscanner"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "cmdscanner"), nil
+}
+
+// sinksCacheKey derives a stable cache filename from the active sink
+// configuration, so switching -extra-sinks doesn't return stale results
+// cached under a different detector configuration.
+func sinksCacheKey(sinks []Sink) string {
+	names := make([]string, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink.String()
+	}
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, "\n")))
+	return hex.EncodeToString(sum[:])[:16]
+}
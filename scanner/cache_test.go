@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFixtureFile(t *testing.T, dir, name, content string) (string, os.FileInfo) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("writing fixture file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat fixture file: %v", err)
+	}
+	return path, info
+}
+
+func TestFileCacheLookupStore(t *testing.T) {
+	dir := t.TempDir()
+	path, info := writeFixtureFile(t, dir, "a.go", "package a\n")
+
+	fc := &fileCache{entries: map[string]fileCacheEntry{}}
+
+	if _, ok := fc.lookup(path, info); ok {
+		t.Fatalf("lookup on empty cache: got hit, want miss")
+	}
+
+	entry := fileCacheEntry{
+		PackagePath: "example.com/a",
+		Lines:       []LineMatch{{LineNumber: 1, Content: "exec.Command(x)", Sink: "os/exec.Command"}},
+	}
+	fc.store(path, info, entry)
+
+	got, ok := fc.lookup(path, info)
+	if !ok {
+		t.Fatalf("lookup after store: got miss, want hit")
+	}
+	if got.PackagePath != entry.PackagePath || !reflect.DeepEqual(got.Lines, entry.Lines) {
+		t.Errorf("lookup() = %#v, want %#v", got, entry)
+	}
+
+	// Touching the file (new mtime) must invalidate the cached entry even
+	// though the path is unchanged.
+	newTime := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, newTime, newTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	staleInfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat after chtimes: %v", err)
+	}
+	if _, ok := fc.lookup(path, staleInfo); ok {
+		t.Errorf("lookup after mtime change: got hit, want miss")
+	}
+}
+
+func TestFileCacheDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path, info := writeFixtureFile(t, dir, "a.go", "package a\n")
+
+	fc := &fileCache{disabled: true, entries: map[string]fileCacheEntry{}}
+
+	fc.store(path, info, fileCacheEntry{PackagePath: "example.com/a"})
+	if _, ok := fc.lookup(path, info); ok {
+		t.Errorf("lookup on disabled cache: got hit, want miss")
+	}
+	if err := fc.flush(); err != nil {
+		t.Errorf("flush on disabled cache: %v", err)
+	}
+	if fc.path != "" {
+		if _, err := os.Stat(fc.path); err == nil {
+			t.Errorf("flush on disabled cache wrote %s, want no file", fc.path)
+		}
+	}
+}
+
+func TestFileCacheFlushAndReload(t *testing.T) {
+	cacheDir := t.TempDir()
+	fixtureDir := t.TempDir()
+	path, info := writeFixtureFile(t, fixtureDir, "a.go", "package a\n")
+
+	fc := loadFileCache(cacheDir, "testkey", false)
+	entry := fileCacheEntry{
+		PackagePath: "example.com/a",
+		Lines:       []LineMatch{{LineNumber: 3, Content: "exec.Command(x)", Sink: "os/exec.Command"}},
+	}
+	fc.store(path, info, entry)
+	if err := fc.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	reloaded := loadFileCache(cacheDir, "testkey", false)
+	got, ok := reloaded.lookup(path, info)
+	if !ok {
+		t.Fatalf("lookup after reload: got miss, want hit")
+	}
+	if got.PackagePath != entry.PackagePath || !reflect.DeepEqual(got.Lines, entry.Lines) {
+		t.Errorf("lookup() after reload = %#v, want %#v", got, entry)
+	}
+}
+
+func TestTryCachedWholeModule(t *testing.T) {
+	dir := t.TempDir()
+	path, info := writeFixtureFile(t, dir, "a.go", "package a\n")
+
+	t.Run("cache miss returns false", func(t *testing.T) {
+		fc := &fileCache{entries: map[string]fileCacheEntry{}}
+		if _, ok := tryCachedWholeModule(dir, fc); ok {
+			t.Errorf("tryCachedWholeModule() = _, true, want false on empty cache")
+		}
+	})
+
+	t.Run("cache hit with a match assembles it straight from the cache", func(t *testing.T) {
+		fc := &fileCache{entries: map[string]fileCacheEntry{}}
+		fc.store(path, info, fileCacheEntry{
+			PackagePath: "example.com/a",
+			Lines:       []LineMatch{{LineNumber: 1, Content: "exec.Command(x)", Sink: "os/exec.Command"}},
+		})
+
+		matches, ok := tryCachedWholeModule(dir, fc)
+		if !ok {
+			t.Fatalf("tryCachedWholeModule() = _, false, want true")
+		}
+		want := []FileMatch{{
+			FilePath:    path,
+			PackagePath: "example.com/a",
+			Lines:       []LineMatch{{LineNumber: 1, Content: "exec.Command(x)", Sink: "os/exec.Command"}},
+		}}
+		if !reflect.DeepEqual(matches, want) {
+			t.Errorf("tryCachedWholeModule() matches = %#v, want %#v", matches, want)
+		}
+	})
+
+	t.Run("cache hit with no lines is a clean file, omitted from matches", func(t *testing.T) {
+		fc := &fileCache{entries: map[string]fileCacheEntry{}}
+		fc.store(path, info, fileCacheEntry{PackagePath: "example.com/a"})
+
+		matches, ok := tryCachedWholeModule(dir, fc)
+		if !ok {
+			t.Fatalf("tryCachedWholeModule() = _, false, want true")
+		}
+		if len(matches) != 0 {
+			t.Errorf("tryCachedWholeModule() matches = %#v, want empty", matches)
+		}
+	})
+
+	t.Run("disabled cache always short-circuits to false", func(t *testing.T) {
+		fc := &fileCache{disabled: true, entries: map[string]fileCacheEntry{}}
+		if _, ok := tryCachedWholeModule(dir, fc); ok {
+			t.Errorf("tryCachedWholeModule() = _, true, want false on disabled cache")
+		}
+	})
+}
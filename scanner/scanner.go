@@ -0,0 +1,528 @@
+// Package scanner is the cmdscanner detection engine: it walks type-checked
+// Go ASTs looking for calls to a configurable set of dangerous Sinks, and
+// does so concurrently across many module roots with an on-disk cache so
+// repeated runs over large, mostly-unchanged dependency graphs are fast.
+package scanner
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Sink describes a function or method whose invocation we consider dangerous.
+// A Sink with an empty Receiver matches a package-level function; otherwise it
+// matches a method on the named (optionally pointer) receiver type.
+type Sink struct {
+	Package  string // import path declaring the function/method, e.g. "os/exec"
+	Receiver string // receiver type name, e.g. "Cmd"; empty for package-level funcs
+	Pointer  bool   // whether the receiver is used as a pointer (*Receiver)
+	Name     string // function or method name
+}
+
+// String renders the sink the way it is reported to the user.
+func (s Sink) String() string {
+	if s.Receiver == "" {
+		return fmt.Sprintf("%s.%s", s.Package, s.Name)
+	}
+	if s.Pointer {
+		return fmt.Sprintf("(*%s.%s).%s", s.Package, s.Receiver, s.Name)
+	}
+	return fmt.Sprintf("%s.%s.%s", s.Package, s.Receiver, s.Name)
+}
+
+// DefaultSinks are the dangerous sinks cmdscanner always looks for.
+var DefaultSinks = []Sink{
+	{Package: "os/exec", Name: "Command"},
+	{Package: "os/exec", Name: "CommandContext"},
+	{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "Start"},
+	{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "Run"},
+	{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "Output"},
+	{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "CombinedOutput"},
+}
+
+// Finding categories. A single call can produce matches in more than one
+// category, e.g. an os/exec.Command call is always a CategoryCommandExec
+// match and may additionally be a CategoryUnsafePathLookup match.
+const (
+	CategoryCommandExec      = "CommandExec"
+	CategoryUnsafePathLookup = "UnsafePathLookup"
+)
+
+// LineMatch represents a single dangerous call found in a file
+type LineMatch struct {
+	LineNumber int
+	Content    string // source text of the call expression
+	Sink       string // descriptor of the sink that was matched, e.g. "os/exec.Command"
+	ConstArgs  bool   // true if every argument to the call is a compile-time constant
+	Category   string // finding class, e.g. CategoryCommandExec or CategoryUnsafePathLookup
+}
+
+// FileMatch represents a match of a dangerous call in a file
+type FileMatch struct {
+	FilePath      string
+	Lines         []LineMatch
+	ModulePath    string // module providing this file, e.g. "github.com/foo/bar"
+	ModuleVersion string
+	Indirect      bool
+	PackagePath   string   // import path of the package containing FilePath
+	ImportChain   []string // shortest chain from the main module to PackagePath, set by callers
+}
+
+// Target is a single module root (or vendored package subset of one) to
+// scan, along with the module metadata to stamp onto any matches it yields.
+type Target struct {
+	ModulePath    string
+	ModuleVersion string
+	Indirect      bool
+	Dir           string   // directory to load packages from
+	Patterns      []string // package patterns to load; "./..." (every package under Dir) when empty
+}
+
+// TargetResult is the outcome of scanning a single Target.
+type TargetResult struct {
+	Target  Target
+	Matches []FileMatch
+	Err     error
+}
+
+// Scanner scans a set of Targets for calls to Sinks.
+type Scanner struct {
+	Sinks    []Sink
+	Workers  int    // concurrent worker count; <= 0 means runtime.NumCPU()
+	CacheDir string // on-disk result cache root; "" means the XDG default
+	NoCache  bool   // disable the on-disk result cache entirely
+
+	cacheOnce sync.Once
+	cache     *fileCache
+}
+
+// New returns a Scanner that looks for sinks, using the default worker
+// count and cache location.
+func New(sinks []Sink) *Scanner {
+	return &Scanner{Sinks: sinks}
+}
+
+func (s *Scanner) ensureCache() *fileCache {
+	s.cacheOnce.Do(func() {
+		dir := s.CacheDir
+		if dir == "" {
+			if d, err := defaultCacheDir(); err == nil {
+				dir = d
+			}
+		}
+		s.cache = loadFileCache(dir, sinksCacheKey(s.Sinks), s.NoCache || dir == "")
+	})
+	return s.cache
+}
+
+func (s *Scanner) workerCount(n int) int {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// Scan scans every target concurrently over a bounded worker pool (default
+// runtime.NumCPU()) and returns one TargetResult per input Target, in the
+// same order. Targets that resolve to the same directory and patterns (the
+// same module reachable through more than one requirement path) are only
+// scanned once and share their result. Every scanned file's result is
+// persisted to the on-disk cache, keyed by (path, mtime, size), so that a
+// later run - even from a different project that happens to depend on the
+// same module version - can skip re-parsing and re-type-checking it.
+func (s *Scanner) Scan(targets []Target) []TargetResult {
+	fc := s.ensureCache()
+
+	type dedupKey struct{ dir, patterns string }
+	first := make(map[dedupKey]int, len(targets))
+	var toRun []int
+	for i, t := range targets {
+		key := dedupKey{t.Dir, strings.Join(t.Patterns, ",")}
+		if _, ok := first[key]; !ok {
+			first[key] = i
+			toRun = append(toRun, i)
+		}
+	}
+
+	raw := make([]TargetResult, len(targets))
+	if len(toRun) > 0 {
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < s.workerCount(len(toRun)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for idx := range jobs {
+					matches, err := s.scanTarget(targets[idx], fc)
+					raw[idx] = TargetResult{Target: targets[idx], Matches: matches, Err: err}
+				}
+			}()
+		}
+		for _, idx := range toRun {
+			jobs <- idx
+		}
+		close(jobs)
+		wg.Wait()
+	}
+
+	results := make([]TargetResult, len(targets))
+	for i, t := range targets {
+		key := dedupKey{t.Dir, strings.Join(t.Patterns, ",")}
+		src := raw[first[key]]
+		results[i] = TargetResult{Target: t, Err: src.Err}
+		if src.Err != nil {
+			continue
+		}
+		matches := make([]FileMatch, len(src.Matches))
+		copy(matches, src.Matches)
+		for j := range matches {
+			matches[j].ModulePath = t.ModulePath
+			matches[j].ModuleVersion = t.ModuleVersion
+			matches[j].Indirect = t.Indirect
+		}
+		results[i].Matches = matches
+	}
+
+	// Best-effort: a cache write failure should never fail the scan itself.
+	_ = fc.flush()
+
+	return results
+}
+
+// scanTarget scans a single target, first checking whether every file it
+// would load is already cached (the common case for an unchanged dependency
+// tree), which lets it skip the expensive packages.Load/type-check step
+// entirely.
+func (s *Scanner) scanTarget(t Target, fc *fileCache) ([]FileMatch, error) {
+	if len(t.Patterns) == 0 {
+		if matches, ok := tryCachedWholeModule(t.Dir, fc); ok {
+			return matches, nil
+		}
+	}
+	return findCommandPatternsInGoFiles(t.Dir, t.Patterns, s.Sinks, fc)
+}
+
+// tryCachedWholeModule reports whether every non-test .go file under dir has
+// a valid, unchanged cache entry, and if so returns the matches assembled
+// straight from the cache without loading any packages. patterns-scoped
+// targets (vendor mode) don't use this path, since discovering the exact
+// file set for an arbitrary package subset without go/packages is its own
+// problem; they still populate the cache per file, just without this
+// whole-module short-circuit.
+func tryCachedWholeModule(dir string, fc *fileCache) ([]FileMatch, bool) {
+	if fc.disabled {
+		return nil, false
+	}
+	files, err := collectGoFiles(dir)
+	if err != nil {
+		return nil, false
+	}
+
+	matches := make([]FileMatch, 0, len(files))
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false
+		}
+		entry, ok := fc.lookup(path, info)
+		if !ok {
+			return nil, false
+		}
+		if len(entry.Lines) == 0 {
+			continue
+		}
+		matches = append(matches, FileMatch{FilePath: path, PackagePath: entry.PackagePath, Lines: entry.Lines})
+	}
+	return matches, true
+}
+
+// collectGoFiles returns every non-test .go file under dir, skipping
+// vendor/testdata/hidden directories. This approximates the file selection
+// findCommandPatternsInGoFiles gets from go/packages with Tests: false, but
+// it applies no build constraints and does not skip nested modules or
+// _-prefixed directories, so it can list files go/packages never loads;
+// such files have no cache entry and make tryCachedWholeModule miss.
+func collectGoFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case "vendor", "testdata":
+				return filepath.SkipDir
+			}
+			if d.Name() != "." && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// matchSink reports whether obj is the function or method described by sink.
+func matchSink(obj *types.Func, sink Sink) bool {
+	if obj.Name() != sink.Name {
+		return false
+	}
+	if obj.Pkg() == nil || obj.Pkg().Path() != sink.Package {
+		return false
+	}
+	sig, ok := obj.Type().(*types.Signature)
+	if !ok {
+		return false
+	}
+	recv := sig.Recv()
+	if sink.Receiver == "" {
+		return recv == nil
+	}
+	if recv == nil {
+		return false
+	}
+	recvType := recv.Type()
+	ptr, isPtr := recvType.(*types.Pointer)
+	if isPtr {
+		recvType = ptr.Elem()
+	}
+	named, ok := recvType.(*types.Named)
+	if !ok || named.Obj().Name() != sink.Receiver {
+		return false
+	}
+	return isPtr == sink.Pointer
+}
+
+// resolveCallee resolves the function or method being called by call, or nil
+// if it cannot be resolved to a statically known *types.Func (e.g. it is a
+// call through a func-typed variable or interface method).
+func resolveCallee(info *types.Info, call *ast.CallExpr) *types.Func {
+	var ident *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return nil
+	}
+	obj := info.Uses[ident]
+	fn, _ := obj.(*types.Func)
+	return fn
+}
+
+// argsAreConstant reports whether every argument expression in args is a
+// compile-time constant.
+func argsAreConstant(info *types.Info, args []ast.Expr) bool {
+	for _, arg := range args {
+		tv, ok := info.Types[arg]
+		if !ok || tv.Value == nil || tv.Value.Kind() == constant.Unknown {
+			return false
+		}
+	}
+	return true
+}
+
+// unsafePathLookupFunc pairs a Sink with the index of its program-name
+// argument. CommandContext's first parameter is a context.Context rather
+// than the program name, so its program argument sits one slot later than
+// Command's and LookPath's.
+type unsafePathLookupFunc struct {
+	Sink
+	ArgIndex int
+}
+
+// unsafePathLookupFuncs are the os/exec entry points whose program-name
+// argument is resolved via PATH lookup rather than a fixed executable.
+var unsafePathLookupFuncs = []unsafePathLookupFunc{
+	{Sink: Sink{Package: "os/exec", Name: "Command"}, ArgIndex: 0},
+	{Sink: Sink{Package: "os/exec", Name: "CommandContext"}, ArgIndex: 1},
+	{Sink: Sink{Package: "os/exec", Name: "LookPath"}, ArgIndex: 0},
+}
+
+// unsafePathLookupArgIndex reports whether fn is one of unsafePathLookupFuncs
+// and, if so, the index of its program-name argument.
+func unsafePathLookupArgIndex(fn *types.Func) (int, bool) {
+	for _, f := range unsafePathLookupFuncs {
+		if matchSink(fn, f.Sink) {
+			return f.ArgIndex, true
+		}
+	}
+	return 0, false
+}
+
+// isUnsafeProgramArg reports whether arg, the program-name argument of an
+// os/exec call, resolves executables via the current working directory: this
+// is true both for constant strings that are not absolute and contain no
+// path separator, and for any argument whose value cannot be proven safe at
+// compile time (modeled here as "not a constant string").
+func isUnsafeProgramArg(info *types.Info, arg ast.Expr) bool {
+	tv, ok := info.Types[arg]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return true
+	}
+	name := constant.StringVal(tv.Value)
+	if filepath.IsAbs(name) || strings.ContainsAny(name, `/\`) {
+		return false
+	}
+	return true
+}
+
+// sourceRange returns the source text spanning from start to end, which must
+// be positions within the same file.
+func sourceRange(start, end token.Position) (string, error) {
+	data, err := os.ReadFile(start.Filename)
+	if err != nil {
+		return "", err
+	}
+	if start.Offset < 0 || end.Offset > len(data) || start.Offset > end.Offset {
+		return "", fmt.Errorf("invalid source range in %s", start.Filename)
+	}
+	return strings.TrimSpace(string(data[start.Offset:end.Offset])), nil
+}
+
+// findCommandPatternsInGoFiles loads the Go packages matching patterns from
+// dir and reports every call that resolves to one of sinks. Unlike a textual
+// scan, this walks type-checked ASTs, so it resolves selector expressions to
+// their declaring package/method and ignores comments, string literals, and
+// unrelated types that merely share a method name with a sink. patterns
+// defaults to "./..." (every package under dir) when empty; callers doing
+// vendor-aware scanning instead pass the exact set of vendored package
+// import paths, letting Go's automatic vendor-consistency resolution load
+// them from dir's vendor/ directory. Every inspected file's result, matches
+// or not, is recorded in fc so later scans can skip it entirely.
+func findCommandPatternsInGoFiles(dir string, patterns []string, sinks []Sink, fc *fileCache) ([]FileMatch, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+			packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:   dir,
+		Tests: false,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("loading packages %s under %s: %w", strings.Join(patterns, " "), dir, err)
+	}
+
+	byFile := map[string]*FileMatch{}
+	var order []string
+	inspected := map[string]string{} // every file we looked at -> its package path
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, file := range pkg.Syntax {
+			fset := pkg.Fset
+			filename := fset.Position(file.Pos()).Filename
+			inspected[filename] = pkg.PkgPath
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn := resolveCallee(pkg.TypesInfo, call)
+				if fn == nil {
+					return true
+				}
+
+				pos := fset.Position(call.Pos())
+				end := fset.Position(call.End())
+				content, readErr := sourceRange(pos, end)
+				fileMatch := func() *FileMatch {
+					fm, exists := byFile[pos.Filename]
+					if !exists {
+						fm = &FileMatch{FilePath: pos.Filename, PackagePath: pkg.PkgPath}
+						byFile[pos.Filename] = fm
+						order = append(order, pos.Filename)
+					}
+					return fm
+				}
+
+				for _, sink := range sinks {
+					if !matchSink(fn, sink) {
+						continue
+					}
+					sinkContent := content
+					if readErr != nil {
+						sinkContent = sink.String() + "(...)"
+					}
+					fm := fileMatch()
+					fm.Lines = append(fm.Lines, LineMatch{
+						LineNumber: pos.Line,
+						Content:    sinkContent,
+						Sink:       sink.String(),
+						ConstArgs:  argsAreConstant(pkg.TypesInfo, call.Args),
+						Category:   CategoryCommandExec,
+					})
+					break
+				}
+
+				if argIndex, ok := unsafePathLookupArgIndex(fn); ok && len(call.Args) > argIndex && isUnsafeProgramArg(pkg.TypesInfo, call.Args[argIndex]) {
+					pathContent := content
+					if readErr != nil {
+						pathContent = fn.Name() + "(...)"
+					}
+					fm := fileMatch()
+					fm.Lines = append(fm.Lines, LineMatch{
+						LineNumber: pos.Line,
+						Content:    pathContent,
+						Sink:       Sink{Package: "os/exec", Name: fn.Name()}.String(),
+						ConstArgs:  argsAreConstant(pkg.TypesInfo, call.Args),
+						Category:   CategoryUnsafePathLookup,
+					})
+				}
+
+				return true
+			})
+		}
+	}
+
+	matches := make([]FileMatch, 0, len(order))
+	for _, filename := range order {
+		matches = append(matches, *byFile[filename])
+	}
+
+	for filename, pkgPath := range inspected {
+		info, statErr := os.Stat(filename)
+		if statErr != nil {
+			continue
+		}
+		var lines []LineMatch
+		if fm, ok := byFile[filename]; ok {
+			lines = fm.Lines
+		}
+		fc.store(filename, info, fileCacheEntry{PackagePath: pkgPath, Lines: lines})
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,201 @@
+package scanner
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeExecPackage type-checks a small synthetic package shaped like os/exec
+// (a package-level func and a pointer-receiver method) under the import path
+// "os/exec", so matchSink can be exercised against real *types.Func objects
+// without depending on the real standard library package.
+func fakeExecPackage(t *testing.T) *types.Package {
+	t.Helper()
+
+	const src = `package exec
+
+type Cmd struct{}
+
+func Command(name string, args ...string) *Cmd { return &Cmd{} }
+
+func (c *Cmd) Run() error { return nil }
+
+func (c Cmd) String() string { return "" }
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "exec.go", src, 0)
+	if err != nil {
+		t.Fatalf("parsing fixture: %v", err)
+	}
+
+	conf := types.Config{Importer: nil}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	pkg, err := conf.Check("os/exec", fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatalf("type-checking fixture: %v", err)
+	}
+	return pkg
+}
+
+func lookupFunc(t *testing.T, pkg *types.Package, recv, name string) *types.Func {
+	t.Helper()
+
+	if recv == "" {
+		obj := pkg.Scope().Lookup(name)
+		fn, ok := obj.(*types.Func)
+		if !ok {
+			t.Fatalf("%s is not a *types.Func: %#v", name, obj)
+		}
+		return fn
+	}
+
+	named, ok := pkg.Scope().Lookup(recv).Type().(*types.Named)
+	if !ok {
+		t.Fatalf("%s is not a named type", recv)
+	}
+	for i := 0; i < named.NumMethods(); i++ {
+		if m := named.Method(i); m.Name() == name {
+			return m
+		}
+	}
+	t.Fatalf("no method %s on %s", name, recv)
+	return nil
+}
+
+func TestMatchSink(t *testing.T) {
+	pkg := fakeExecPackage(t)
+
+	command := lookupFunc(t, pkg, "", "Command")
+	run := lookupFunc(t, pkg, "Cmd", "Run")
+	stringMethod := lookupFunc(t, pkg, "Cmd", "String")
+
+	tests := []struct {
+		name string
+		fn   *types.Func
+		sink Sink
+		want bool
+	}{
+		{
+			name: "matching package-level func",
+			fn:   command,
+			sink: Sink{Package: "os/exec", Name: "Command"},
+			want: true,
+		},
+		{
+			name: "package-level func, wrong name",
+			fn:   command,
+			sink: Sink{Package: "os/exec", Name: "CommandContext"},
+			want: false,
+		},
+		{
+			name: "package-level func, wrong package",
+			fn:   command,
+			sink: Sink{Package: "github.com/foo/sh", Name: "Command"},
+			want: false,
+		},
+		{
+			name: "matching pointer-receiver method",
+			fn:   run,
+			sink: Sink{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "Run"},
+			want: true,
+		},
+		{
+			name: "method matched against package-level sink (no receiver)",
+			fn:   run,
+			sink: Sink{Package: "os/exec", Name: "Run"},
+			want: false,
+		},
+		{
+			name: "package-level func matched against a receiver sink",
+			fn:   command,
+			sink: Sink{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "Command"},
+			want: false,
+		},
+		{
+			name: "pointer-receiver method, sink expects value receiver",
+			fn:   run,
+			sink: Sink{Package: "os/exec", Receiver: "Cmd", Pointer: false, Name: "Run"},
+			want: false,
+		},
+		{
+			name: "value-receiver method matches value-receiver sink",
+			fn:   stringMethod,
+			sink: Sink{Package: "os/exec", Receiver: "Cmd", Pointer: false, Name: "String"},
+			want: true,
+		},
+		{
+			name: "value-receiver method does not match pointer-receiver sink",
+			fn:   stringMethod,
+			sink: Sink{Package: "os/exec", Receiver: "Cmd", Pointer: true, Name: "String"},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchSink(tt.fn, tt.sink); got != tt.want {
+				t.Errorf("matchSink(%s, %v) = %v, want %v", tt.fn.Name(), tt.sink, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestScanDedupesAndRestampsMetadata exercises two Targets that point at the
+// same directory with no patterns, i.e. the same dedup key: Scan must only
+// load/type-check the underlying package once, but still stamp each result
+// with its own Target's module metadata rather than leaking the first
+// Target's into the second's.
+func TestScanDedupesAndRestampsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/fixture\n\ngo 1.21\n"), 0o644); err != nil {
+		t.Fatalf("writing go.mod: %v", err)
+	}
+	const src = `package fixture
+
+import "os/exec"
+
+func run() {
+	exec.Command("ls").Run()
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o644); err != nil {
+		t.Fatalf("writing main.go: %v", err)
+	}
+
+	sc := &Scanner{Sinks: DefaultSinks, NoCache: true}
+	targets := []Target{
+		{ModulePath: "example.com/one", ModuleVersion: "v1.0.0", Dir: dir},
+		{ModulePath: "example.com/two", ModuleVersion: "v2.0.0", Indirect: true, Dir: dir},
+	}
+
+	results := sc.Scan(targets)
+	if len(results) != len(targets) {
+		t.Fatalf("Scan() returned %d results, want %d", len(results), len(targets))
+	}
+
+	for i, result := range results {
+		if result.Err != nil {
+			t.Fatalf("results[%d].Err = %v, want nil", i, result.Err)
+		}
+		if len(result.Matches) != 1 || len(result.Matches[0].Lines) == 0 {
+			t.Fatalf("results[%d].Matches = %#v, want exactly one file with at least one line", i, result.Matches)
+		}
+		fm := result.Matches[0]
+		want := targets[i]
+		if fm.ModulePath != want.ModulePath || fm.ModuleVersion != want.ModuleVersion || fm.Indirect != want.Indirect {
+			t.Errorf("results[%d].Matches[0] = {ModulePath: %q, ModuleVersion: %q, Indirect: %v}, want {%q, %q, %v}",
+				i, fm.ModulePath, fm.ModuleVersion, fm.Indirect, want.ModulePath, want.ModuleVersion, want.Indirect)
+		}
+	}
+
+	// The two results share one dedup'd scan but must carry their own
+	// restamped metadata rather than the same values.
+	if results[0].Matches[0].ModulePath == results[1].Matches[0].ModulePath {
+		t.Errorf("both results share ModulePath %q, want distinct per-target values", results[0].Matches[0].ModulePath)
+	}
+}